@@ -10,44 +10,208 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"regexp"
+	"sort"
 	"strings"
+	"unicode"
 )
 
-func Load(filename string, override ...bool) (err error) {
+// Load reads the given files in order and sets their variables in the
+// process environment, without overriding variables that are already set.
+// When a key is defined in more than one file, the value from the first
+// file it appears in wins. If no filenames are given, Load defaults to
+// ".env" in the working directory.
+func Load(filenames ...string) error {
+	lines, err := loadFiles(filenames, false)
+	if err != nil {
+		return err
+	}
+
+	return setEnvVars(lines, false)
+}
+
+// Overload works like Load, except that it overrides variables that are
+// already set in the process environment, and when a key is defined in
+// more than one file, the value from the last file it appears in wins.
+func Overload(filenames ...string) error {
+	lines, err := loadFiles(filenames, true)
+	if err != nil {
+		return err
+	}
+
+	return setEnvVars(lines, true)
+}
+
+// Read parses the given files and returns the merged result without
+// touching the process environment. Later files override earlier ones,
+// matching Overload's precedence. If no filenames are given, Read
+// defaults to ".env" in the working directory.
+func Read(filenames ...string) (map[string]string, error) {
+	return loadFiles(filenames, true)
+}
+
+// LoadFile loads a single file into the process environment.
+//
+// Deprecated: use Load or Overload instead.
+func LoadFile(filename string, override ...bool) (err error) {
 	// Override is only variadic to make it optional.
 	// If more than one boolean is set, return an error.
 	if len(override) > 1 {
-		return errors.New("too many arguments in call to env.Load")
+		return errors.New("too many arguments in call to env.LoadFile")
+	}
+
+	if len(override) > 0 && override[0] {
+		return Overload(filename)
+	}
+
+	return Load(filename)
+}
+
+// loadFiles parses filenames in order and merges the results into a single
+// map. When overload is false, the first file a key appears in wins; when
+// true, the last file wins.
+func loadFiles(filenames []string, overload bool) (map[string]string, error) {
+	if len(filenames) == 0 {
+		filenames = []string{".env"}
+	}
+
+	merged := make(map[string]string)
+
+	for _, filename := range filenames {
+		lines, err := parseFile(filename)
+		if err != nil {
+			return nil, err
+		}
+
+		for key, val := range lines {
+			if _, exists := merged[key]; overload || !exists {
+				merged[key] = val
+			}
+		}
 	}
 
-	lines, err := Parse(filename)
+	return merged, nil
+}
+
+// Parse reads dotenv-formatted content from r and returns the parsed
+// key/value pairs without touching the process environment or the
+// filesystem.
+func Parse(r io.Reader) (lines map[string]string, err error) {
+	lines = make(map[string]string, 100)
+
+	err = scanFile(r, lines)
 	if err != nil {
-		return
+		return nil, err
 	}
 
-	err = setEnvVars(lines, len(override) > 0 && override[0])
+	err = processLines(lines)
 	if err != nil {
-		return fmt.Errorf("%s: %w", filename, err)
+		return nil, err
 	}
 
-	return nil
+	return lines, nil
 }
 
-func Parse(filename string) (lines map[string]string, err error) {
-	file, err := os.Open(filename)
+// Unmarshal parses str as dotenv-formatted content and returns the parsed
+// key/value pairs. It is equivalent to Parse(strings.NewReader(str)).
+func Unmarshal(str string) (map[string]string, error) {
+	return Parse(strings.NewReader(str))
+}
+
+// Marshal serializes envMap into dotenv file format, sorting keys for a
+// deterministic result. Values containing whitespace, '#', '$', '"', '\',
+// or newlines, and values that start or end with a quote character, are
+// double-quoted with the escape sequences understood by Parse; other values
+// are left unquoted.
+func Marshal(envMap map[string]string) (string, error) {
+	keys := make([]string, 0, len(envMap))
+	for key := range envMap {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var sb strings.Builder
+	for _, key := range keys {
+		sb.WriteString(key)
+		sb.WriteByte('=')
+		sb.WriteString(marshalValue(envMap[key]))
+		sb.WriteByte('\n')
+	}
+
+	return sb.String(), nil
+}
+
+// Write marshals envMap and writes the result to filename.
+func Write(envMap map[string]string, filename string) error {
+	content, err := Marshal(envMap)
 	if err != nil {
-		return nil, fmt.Errorf("error opening %s: %w", filename, err)
+		return err
 	}
-	defer file.Close()
 
-	lines = make(map[string]string, 100)
+	// .env files typically hold credentials, so default to owner-only
+	// permissions rather than the world-readable 0644.
+	if err := os.WriteFile(filename, []byte(content), 0600); err != nil {
+		return fmt.Errorf("error writing %s: %w", filename, err)
+	}
+
+	return nil
+}
 
-	err = scanFile(file, lines)
+// marshalValue renders a single value for Marshal, double-quoting and
+// escaping it when it contains characters that would otherwise change its
+// meaning on reparse.
+func marshalValue(val string) string {
+	if !needsQuoting(val) {
+		return val
+	}
+
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for _, r := range val {
+		switch r {
+		case '\\':
+			sb.WriteString(`\\`)
+		case '"':
+			sb.WriteString(`\"`)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\r':
+			sb.WriteString(`\r`)
+		case '\t':
+			sb.WriteString(`\t`)
+		case '$':
+			sb.WriteString(`\$`)
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	sb.WriteByte('"')
+
+	return sb.String()
+}
+
+func needsQuoting(val string) bool {
+	if val == "" {
+		return false
+	}
+	if strings.ContainsAny(val, "#$\"\\") || strings.IndexFunc(val, unicode.IsSpace) >= 0 {
+		return true
+	}
+	// A value that starts or ends with a quote character would otherwise be
+	// misread as quoted (and have those quotes stripped) on reparse.
+	first, last := val[0], val[len(val)-1]
+	return first == '\'' || first == '"' || last == '\'' || last == '"'
+}
+
+// parseFile opens filename and parses its contents.
+func parseFile(filename string) (map[string]string, error) {
+	file, err := os.Open(filename)
 	if err != nil {
-		return nil, fmt.Errorf("%s: %w", filename, err)
+		return nil, fmt.Errorf("error opening %s: %w", filename, err)
 	}
+	defer file.Close()
 
-	err = processLines(lines)
+	lines, err := Parse(file)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", filename, err)
 	}
@@ -55,19 +219,34 @@ func Parse(filename string) (lines map[string]string, err error) {
 	return lines, nil
 }
 
+// utf8BOM is the byte-order-mark some editors (notably on Windows) prepend
+// to UTF-8 files. It's stripped from the first scanned line so it doesn't
+// end up as part of the first key name.
+const utf8BOM = "\xef\xbb\xbf"
+
 func scanFile(r io.Reader, lines map[string]string) error {
 	scanner := bufio.NewScanner(r)
 
 	lineNum := 0
 	for scanner.Scan() {
 		lineNum++
-		line := strings.TrimSpace(scanner.Text())
+		raw := scanner.Text()
+		if lineNum == 1 {
+			raw = strings.TrimPrefix(raw, utf8BOM)
+		}
+		line := strings.TrimSpace(raw)
 
 		// Skip empty lines and comments
 		if line == "" || strings.HasPrefix(line, "#") {
 			continue
 		}
 
+		// Shell scripts commonly source a .env file, so allow lines of the
+		// form "export KEY=VALUE" by stripping the "export" keyword.
+		if rest, ok := strings.CutPrefix(line, "export"); ok && len(rest) > 0 && isSpace(rest[0]) {
+			line = strings.TrimSpace(rest)
+		}
+
 		key, val, found := strings.Cut(line, "=")
 		if !found {
 			return fmt.Errorf("line %d: %q key defined without \"=\" separator or value", lineNum, line)
@@ -76,9 +255,19 @@ func scanFile(r io.Reader, lines map[string]string) error {
 		key = strings.TrimSpace(key)
 		val = strings.TrimSpace(val)
 
-		// Empty keys are not allowed (e.g. =VALUE)
-		if key == "" {
-			return fmt.Errorf("line %d: %q value defined without key", lineNum, line)
+		if err := validateKey(key, lineNum); err != nil {
+			return err
+		}
+
+		if quote, open := openQuote(val); open {
+			startLine := lineNum
+			var multiline string
+			var err error
+			multiline, lineNum, err = consumeMultilineValue(scanner, val, quote, lineNum)
+			if err != nil {
+				return fmt.Errorf("line %d: %w", startLine, err)
+			}
+			val = multiline
 		}
 
 		lines[key] = stripInlineComments(val)
@@ -87,7 +276,99 @@ func scanFile(r io.Reader, lines map[string]string) error {
 	return scanner.Err()
 }
 
+// openQuote reports whether val opens a quoted value ('"' or '\'') that has
+// no closing quote yet, meaning scanFile must keep reading lines until one
+// is found.
+func openQuote(val string) (quote byte, open bool) {
+	if len(val) == 0 {
+		return 0, false
+	}
+
+	quote = val[0]
+	if quote != '"' && quote != '\'' {
+		return 0, false
+	}
+
+	if findClosingQuote(val[1:], quote) >= 0 {
+		return 0, false
+	}
+
+	return quote, true
+}
+
+// findClosingQuote returns the index of the first byte in s equal to quote,
+// or -1 if there is none. For double-quoted values it skips backslash
+// escape pairs (e.g. `\"`) the same way processEscapeSequences will later
+// interpret them, so an escaped quote doesn't look like the closing one.
+// Single-quoted values have no escape sequences, so every occurrence of
+// quote closes them.
+func findClosingQuote(s string, quote byte) int {
+	for i := 0; i < len(s); i++ {
+		if quote == '"' && s[i] == '\\' && i+1 < len(s) {
+			i++
+			continue
+		}
+		if s[i] == quote {
+			return i
+		}
+	}
+	return -1
+}
+
+// consumeMultilineValue keeps reading lines from scanner, appending them to
+// val (preserving embedded newlines), until a line containing the closing
+// quote is found.
+func consumeMultilineValue(scanner *bufio.Scanner, val string, quote byte, lineNum int) (string, int, error) {
+	for {
+		if !scanner.Scan() {
+			if err := scanner.Err(); err != nil {
+				return "", lineNum, err
+			}
+			return "", lineNum, fmt.Errorf("unterminated quoted value (missing closing %c)", quote)
+		}
+		lineNum++
+
+		val += "\n" + scanner.Text()
+		if findClosingQuote(val[1:], quote) >= 0 {
+			return val, lineNum, nil
+		}
+	}
+}
+
+// keyPattern matches valid dotenv keys: POSIX-style identifiers that may
+// also contain dots, as accepted by compose-go.
+var keyPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*$`)
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t'
+}
+
+func validateKey(key string, lineNum int) error {
+	if key == "" {
+		return fmt.Errorf("line %d: value defined without key", lineNum)
+	}
+
+	if key[0] >= '0' && key[0] <= '9' {
+		return fmt.Errorf("line %d: %q is not a valid key: keys cannot start with a digit", lineNum, key)
+	}
+
+	if !keyPattern.MatchString(key) {
+		return fmt.Errorf("line %d: %q is not a valid key", lineNum, key)
+	}
+
+	return nil
+}
+
 func processLines(lines map[string]string) (err error) {
+	lookup := func(key string) (string, bool) {
+		if val, exists := lines[key]; exists {
+			// Strip quotes before returning because there's no guarantee
+			// all inputs have been stripped yet
+			return stripQuotes(val), true
+		}
+		return os.LookupEnv(key)
+	}
+
 	for key, val := range lines {
 		if doubleQuoted(val) {
 			unquoted := stripQuotes(val)
@@ -97,11 +378,19 @@ func processLines(lines map[string]string) (err error) {
 				// What if someone does something like TESTING="value with %d literal percent d"?
 				return fmt.Errorf("error processing escape sequences in %s=%s key-value pair: %w", key, val, err)
 			}
-			lines[key] = expandVariables(processed, lines)
+			expanded, err := Expand(processed, lookup)
+			if err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+			lines[key] = expanded
 		} else if singleQuoted(val) {
 			lines[key] = stripQuotes(val)
 		} else {
-			lines[key] = expandVariables(val, lines)
+			expanded, err := Expand(val, lookup)
+			if err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+			lines[key] = expanded
 		}
 	}
 
@@ -154,28 +443,194 @@ func processEscapeSequences(s string) (string, error) {
 	return result.String(), nil
 }
 
-func expandVariables(s string, m map[string]string) string {
-	// Return early if there's nothing to expand
-	if !strings.Contains(s, "$") {
-		return s
+// ErrRequiredVarMissing is returned by Expand when a "${VAR:?error}" or
+// "${VAR?error}" reference is expanded and VAR is unset (or, for the ":?"
+// form, empty).
+var ErrRequiredVarMissing = errors.New("required variable missing")
+
+// Expand replaces variable references in s using lookup to resolve each
+// name to a value. Beyond bare "$VAR" and "${VAR}" references, it supports
+// the POSIX-shell parameter expansion operators also accepted by
+// docker-compose's .env parser:
+//
+//   - "${VAR:-default}" uses default if VAR is unset or empty.
+//   - "${VAR-default}" uses default if VAR is unset.
+//   - "${VAR:?message}" / "${VAR?message}" fail the expansion with message,
+//     wrapped in ErrRequiredVarMissing, if VAR is unset (":?" also fails on
+//     empty).
+//   - "${VAR:+alt}" / "${VAR+alt}" use alt if VAR is set (":+" also
+//     requires non-empty), otherwise the empty string.
+//
+// A literal dollar sign can be produced with "\$" or "$$".
+func Expand(s string, lookup func(string) (string, bool)) (string, error) {
+	var result strings.Builder
+	result.Grow(len(s))
+
+	for i := 0; i < len(s); {
+		// processEscapeSequences leaves "\$" intact so the dollar sign
+		// survives expansion as a literal character instead of starting a
+		// variable reference.
+		if s[i] == '\\' && i+1 < len(s) && s[i+1] == '$' {
+			result.WriteByte('$')
+			i += 2
+			continue
+		}
+
+		if s[i] != '$' || i+1 >= len(s) {
+			result.WriteByte(s[i])
+			i++
+			continue
+		}
+
+		switch {
+		case s[i+1] == '$':
+			result.WriteByte('$')
+			i += 2
+		case s[i+1] == '{':
+			end := matchBrace(s, i+2)
+			if end < 0 {
+				return "", fmt.Errorf("unterminated variable reference starting at position %d", i)
+			}
+
+			val, err := expandExpr(s[i+2:end], lookup)
+			if err != nil {
+				return "", err
+			}
+			result.WriteString(val)
+			i = end + 1
+		default:
+			name, consumed := scanVarName(s[i+1:])
+			if consumed == 0 {
+				result.WriteByte('$')
+				i++
+				continue
+			}
+			if val, exists := lookup(name); exists {
+				result.WriteString(val)
+			}
+			i += 1 + consumed
+		}
 	}
 
-	// Prepare literal dollar signs ($$) for expansion from original escaped dollars (\\$).
-	// This is a workaround for os.Expand() not supporting escape sequences.
-	s = strings.ReplaceAll(s, `\$`, "$$")
+	return result.String(), nil
+}
 
-	return os.Expand(s, func(k string) string {
-		// Replace $$ with $, completing \$ escape sequence
-		if k == "$" {
-			return "$"
+// matchBrace returns the index of the "}" matching the "${" whose body
+// starts at start, accounting for nested "${...}" references (e.g. the
+// default in "${FOO:-${BAR:-baz}}"). It returns -1 if no match is found.
+func matchBrace(s string, start int) int {
+	depth := 1
+	for i := start; i < len(s); i++ {
+		switch {
+		case s[i] == '$' && i+1 < len(s) && s[i+1] == '{':
+			depth++
+			i++
+		case s[i] == '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
 		}
-		if val, exists := m[k]; exists {
-			// Strip quotes before returning because there's no guarentee
-			// all inputs have been stripped yet
-			return stripQuotes(val)
+	}
+	return -1
+}
+
+// scanVarName reads a bare (unbraced) variable name from the start of s,
+// returning the name and the number of bytes consumed.
+func scanVarName(s string) (name string, consumed int) {
+	for consumed < len(s) && isVarNameByte(s[consumed], consumed == 0) {
+		consumed++
+	}
+	return s[:consumed], consumed
+}
+
+func isVarNameByte(c byte, first bool) bool {
+	if c == '_' || (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') {
+		return true
+	}
+	return !first && c >= '0' && c <= '9'
+}
+
+// expandExpr evaluates the contents of a "${...}" reference, which may be a
+// bare name or a name followed by one of the default/required/alternate
+// operators.
+func expandExpr(expr string, lookup func(string) (string, bool)) (string, error) {
+	name, op, arg, hasOp := splitOperator(expr)
+	val, exists := lookup(name)
+
+	if !hasOp {
+		return val, nil
+	}
+
+	switch op {
+	case ":-":
+		if !exists || val == "" {
+			return Expand(arg, lookup)
+		}
+		return val, nil
+	case "-":
+		if !exists {
+			return Expand(arg, lookup)
+		}
+		return val, nil
+	case ":?":
+		if !exists || val == "" {
+			return "", fmt.Errorf("%s: %w", requiredVarMessage(name, arg), ErrRequiredVarMissing)
+		}
+		return val, nil
+	case "?":
+		if !exists {
+			return "", fmt.Errorf("%s: %w", requiredVarMessage(name, arg), ErrRequiredVarMissing)
+		}
+		return val, nil
+	case ":+":
+		if exists && val != "" {
+			return Expand(arg, lookup)
+		}
+		return "", nil
+	default: // "+"
+		if exists {
+			return Expand(arg, lookup)
 		}
-		return ""
-	})
+		return "", nil
+	}
+}
+
+func requiredVarMessage(name, arg string) string {
+	if arg == "" {
+		return fmt.Sprintf("%s is not set", name)
+	}
+	return arg
+}
+
+// splitOperator splits a "${...}" expression body into its variable name
+// and, if present, one of the "-", ":-", "?", ":?", "+", ":+" operators
+// along with its argument.
+func splitOperator(expr string) (name, op, arg string, hasOp bool) {
+	idx := strings.IndexAny(expr, ":-?+")
+	if idx < 0 {
+		return expr, "", "", false
+	}
+
+	name = expr[:idx]
+	rest := expr[idx:]
+
+	switch {
+	case strings.HasPrefix(rest, ":-"):
+		return name, ":-", rest[2:], true
+	case strings.HasPrefix(rest, ":?"):
+		return name, ":?", rest[2:], true
+	case strings.HasPrefix(rest, ":+"):
+		return name, ":+", rest[2:], true
+	case strings.HasPrefix(rest, "-"):
+		return name, "-", rest[1:], true
+	case strings.HasPrefix(rest, "?"):
+		return name, "?", rest[1:], true
+	case strings.HasPrefix(rest, "+"):
+		return name, "+", rest[1:], true
+	}
+
+	return expr, "", "", false
 }
 
 func setEnvVars(lines map[string]string, override bool) (err error) {
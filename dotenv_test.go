@@ -0,0 +1,359 @@
+// Copyright (c) 2025 Brad Lilley. All rights reserved.
+// Use of this source code is governed by the Conduit CMS License
+// that can be found in the LICENSE file.
+
+package env
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func openTestdata(t *testing.T, name string) (*os.File, error) {
+	t.Helper()
+	return os.Open("testdata/" + name)
+}
+
+func testdataPath(name string) string {
+	return "testdata/" + name
+}
+
+// unsetForTest unsets key for the duration of the test, restoring its
+// original value (or absence) afterwards.
+func unsetForTest(t *testing.T, key string) {
+	t.Helper()
+
+	original, existed := os.LookupEnv(key)
+	os.Unsetenv(key)
+	t.Cleanup(func() {
+		if existed {
+			os.Setenv(key, original)
+		} else {
+			os.Unsetenv(key)
+		}
+	})
+}
+
+func TestLoadFilesPrecedence(t *testing.T) {
+	files := []string{testdataPath("multi_a.env"), testdataPath("multi_b.env")}
+
+	load, err := loadFiles(files, false)
+	if err != nil {
+		t.Fatalf("loadFiles(overload=false) error = %v", err)
+	}
+	wantLoad := map[string]string{"SHARED": "a", "ONLY_A": "from_a", "ONLY_B": "from_b"}
+	for key, val := range wantLoad {
+		if load[key] != val {
+			t.Errorf("loadFiles(overload=false)[%q] = %q, want %q", key, load[key], val)
+		}
+	}
+
+	overload, err := loadFiles(files, true)
+	if err != nil {
+		t.Fatalf("loadFiles(overload=true) error = %v", err)
+	}
+	wantOverload := map[string]string{"SHARED": "b", "ONLY_A": "from_a", "ONLY_B": "from_b"}
+	for key, val := range wantOverload {
+		if overload[key] != val {
+			t.Errorf("loadFiles(overload=true)[%q] = %q, want %q", key, overload[key], val)
+		}
+	}
+}
+
+func TestRead(t *testing.T) {
+	// Read should behave like loadFiles(overload=true) and must not touch
+	// the process environment.
+	t.Setenv("SHARED", "process")
+
+	envMap, err := Read(testdataPath("multi_a.env"), testdataPath("multi_b.env"))
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+
+	if want := "b"; envMap["SHARED"] != want {
+		t.Errorf(`envMap["SHARED"] = %q, want %q`, envMap["SHARED"], want)
+	}
+	if got := os.Getenv("SHARED"); got != "process" {
+		t.Errorf("Read() modified the process environment: SHARED = %q", got)
+	}
+}
+
+func TestLoadDoesNotOverrideExistingEnv(t *testing.T) {
+	t.Setenv("ONLY_A", "preset")
+	unsetForTest(t, "SHARED")
+
+	if err := Load(testdataPath("multi_a.env")); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	if got := os.Getenv("ONLY_A"); got != "preset" {
+		t.Errorf("Load() overrode an already-set variable: ONLY_A = %q, want %q", got, "preset")
+	}
+	if got := os.Getenv("SHARED"); got != "a" {
+		t.Errorf("Load() did not set an unset variable: SHARED = %q, want %q", got, "a")
+	}
+}
+
+func TestOverloadOverridesExistingEnv(t *testing.T) {
+	t.Setenv("ONLY_A", "preset")
+
+	if err := Overload(testdataPath("multi_a.env")); err != nil {
+		t.Fatalf("Overload() error = %v", err)
+	}
+
+	if got := os.Getenv("ONLY_A"); got != "from_a" {
+		t.Errorf("Overload() did not override an already-set variable: ONLY_A = %q, want %q", got, "from_a")
+	}
+}
+
+func TestLoadDefaultsToDotEnv(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(dir+"/.env", []byte("DEFAULT_DISCOVERY=found\n"), 0600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Getwd: %v", err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatalf("Chdir: %v", err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	unsetForTest(t, "DEFAULT_DISCOVERY")
+
+	if err := Load(); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	if got := os.Getenv("DEFAULT_DISCOVERY"); got != "found" {
+		t.Errorf("Load() did not discover .env in the working directory: got %q", got)
+	}
+}
+
+func TestMarshalUnmarshalRoundTrip(t *testing.T) {
+	envMap := map[string]string{
+		"PLAIN":         "value",
+		"WITH_SPACE":    "hello world",
+		"WITH_HASH":     "a#b",
+		"WITH_DOLLAR":   "a$b",
+		"WITH_QUOTE":    `a"b`,
+		"WITH_SLASH":    `a\b`,
+		"WITH_NEWLINE":  "line1\nline2",
+		"LEADING_QUOTE": "'quoted'",
+	}
+
+	marshaled, err := Marshal(envMap)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+
+	got, err := Unmarshal(marshaled)
+	if err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+
+	for key, want := range envMap {
+		if got[key] != want {
+			t.Errorf("round-trip[%q] = %q, want %q", key, got[key], want)
+		}
+	}
+}
+
+func TestWriteUsesOwnerOnlyPermissions(t *testing.T) {
+	dir := t.TempDir()
+	filename := dir + "/out.env"
+
+	if err := Write(map[string]string{"FOO": "bar"}, filename); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	info, err := os.Stat(filename)
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+
+	if want := os.FileMode(0600); info.Mode().Perm() != want {
+		t.Errorf("Write() file mode = %v, want %v", info.Mode().Perm(), want)
+	}
+}
+
+func TestExpand(t *testing.T) {
+	lookup := func(vals map[string]string) func(string) (string, bool) {
+		return func(key string) (string, bool) {
+			val, ok := vals[key]
+			return val, ok
+		}
+	}
+
+	tests := []struct {
+		name    string
+		s       string
+		vals    map[string]string
+		want    string
+		wantErr bool
+	}{
+		{"bare var", "$FOO", map[string]string{"FOO": "bar"}, "bar", false},
+		{"bare var unset", "$FOO", nil, "", false},
+		{"braced var", "${FOO}", map[string]string{"FOO": "bar"}, "bar", false},
+		{"literal dollar via $$", "a$$b", nil, "a$b", false},
+		{"literal dollar via backslash", `a\$b`, nil, "a$b", false},
+		{"default when unset", "${FOO:-fallback}", nil, "fallback", false},
+		{"default when empty", "${FOO:-fallback}", map[string]string{"FOO": ""}, "fallback", false},
+		{"default-if-unset keeps empty", "${FOO-fallback}", map[string]string{"FOO": ""}, "", false},
+		{"default-if-unset uses default", "${FOO-fallback}", nil, "fallback", false},
+		{"set value wins over default", "${FOO:-fallback}", map[string]string{"FOO": "bar"}, "bar", false},
+		{"alt when set", "${FOO:+alt}", map[string]string{"FOO": "bar"}, "alt", false},
+		{"alt when unset", "${FOO:+alt}", nil, "", false},
+		{"alt-if-set ignores empty", "${FOO:+alt}", map[string]string{"FOO": ""}, "", false},
+		{"alt-if-exists with empty", "${FOO+alt}", map[string]string{"FOO": ""}, "alt", false},
+		{"required missing", "${FOO:?FOO is required}", nil, "", true},
+		{"required present", "${FOO:?FOO is required}", map[string]string{"FOO": "bar"}, "bar", false},
+		{"nested default", "${FOO:-${BAR:-baz}}", nil, "baz", false},
+		{"nested default resolves inner", "${FOO:-${BAR:-baz}}", map[string]string{"BAR": "qux"}, "qux", false},
+		{"unterminated brace", "${FOO", nil, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Expand(tt.s, lookup(tt.vals))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expand(%q) error = %v, wantErr %v", tt.s, err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got != tt.want {
+				t.Errorf("Expand(%q) = %q, want %q", tt.s, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpandRequiredVarError(t *testing.T) {
+	lookup := func(string) (string, bool) { return "", false }
+
+	_, err := Expand("${FOO:?FOO is required}", lookup)
+	if !errors.Is(err, ErrRequiredVarMissing) {
+		t.Fatalf("Expand() error = %v, want wrapping ErrRequiredVarMissing", err)
+	}
+}
+
+func TestScanFileExportPrefix(t *testing.T) {
+	lines := make(map[string]string)
+
+	file, err := openTestdata(t, "exported.env")
+	if err != nil {
+		t.Fatalf("openTestdata: %v", err)
+	}
+	defer file.Close()
+
+	if err := scanFile(file, lines); err != nil {
+		t.Fatalf("scanFile() error = %v", err)
+	}
+
+	want := map[string]string{
+		"FOO":   "bar",
+		"BAZ":   "qux",
+		"PLAIN": "value",
+	}
+	for key, val := range want {
+		if lines[key] != val {
+			t.Errorf("lines[%q] = %q, want %q", key, lines[key], val)
+		}
+	}
+}
+
+func TestScanFileMultilineQuotedValue(t *testing.T) {
+	lines := make(map[string]string)
+
+	file, err := openTestdata(t, "quoted.env")
+	if err != nil {
+		t.Fatalf("openTestdata: %v", err)
+	}
+	defer file.Close()
+
+	if err := scanFile(file, lines); err != nil {
+		t.Fatalf("scanFile() error = %v", err)
+	}
+
+	if want := "\"line 1\nline 2\""; lines["OPTION_J"] != want {
+		t.Errorf("lines[%q] = %q, want %q", "OPTION_J", lines["OPTION_J"], want)
+	}
+
+	if want := "'single line'"; lines["OPTION_K"] != want {
+		t.Errorf("lines[%q] = %q, want %q", "OPTION_K", lines["OPTION_K"], want)
+	}
+}
+
+func TestScanFileMultilineValueWithEscapedQuote(t *testing.T) {
+	lines := make(map[string]string)
+
+	err := scanFile(strings.NewReader(`FOO="{\"a\":1}
+more}"`), lines)
+	if err != nil {
+		t.Fatalf("scanFile() error = %v", err)
+	}
+
+	want := "\"{\\\"a\\\":1}\nmore}\""
+	if lines["FOO"] != want {
+		t.Errorf("lines[%q] = %q, want %q", "FOO", lines["FOO"], want)
+	}
+}
+
+func TestScanFileUnterminatedQuotedValue(t *testing.T) {
+	lines := make(map[string]string)
+
+	err := scanFile(strings.NewReader("OPTION_J=\"line 1\nline 2"), lines)
+	if err == nil {
+		t.Fatal("scanFile() error = nil, want unterminated quoted value error")
+	}
+}
+
+func TestScanFileStripsBOM(t *testing.T) {
+	lines := make(map[string]string)
+
+	file, err := openTestdata(t, "bom.env")
+	if err != nil {
+		t.Fatalf("openTestdata: %v", err)
+	}
+	defer file.Close()
+
+	if err := scanFile(file, lines); err != nil {
+		t.Fatalf("scanFile() error = %v", err)
+	}
+
+	if want := "bar"; lines["FOO"] != want {
+		t.Errorf(`lines["FOO"] = %q, want %q`, lines["FOO"], want)
+	}
+	if _, ok := lines["\ufeffFOO"]; ok {
+		t.Error("BOM was not stripped from the first key")
+	}
+}
+
+func TestValidateKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     string
+		wantErr bool
+	}{
+		{"valid", "FOO", false},
+		{"valid with underscore", "_FOO_BAR", false},
+		{"valid with dot", "FOO.BAR", false},
+		{"digit leading", "1FOO", true},
+		{"empty", "", true},
+		{"invalid character", "FOO-BAR", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateKey(tt.key, 1)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateKey(%q) error = %v, wantErr %v", tt.key, err, tt.wantErr)
+			}
+		})
+	}
+}